@@ -0,0 +1,92 @@
+// Package breakerhttp adapts an sre circuit breaker to the net/http.RoundTripper
+// interface, so HTTP clients get adaptive throttling and Retry-After-driven cooldowns
+// without hand-wiring Allow/MarkSuccess/MarkFailed/MarkThrottled around every call.
+package breakerhttp
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Now is the current time function used to resolve Retry-After values given as an
+// HTTP-date. It is a variable so tests can fake the clock.
+var Now = time.Now
+
+// Breaker is the subset of circuit_breaker.CircuitBreaker, extended with MarkThrottled,
+// that RoundTripper needs. github.com/yimi-go/sre-circuit-breaker's breaker type
+// implements it; it is declared here, rather than imported, so this package doesn't
+// force a direct dependency on the sre package's internals.
+type Breaker interface {
+	Allow() error
+	MarkSuccess()
+	MarkFailed()
+	MarkThrottled(retryAfter time.Duration)
+}
+
+// RoundTripper wraps a next http.RoundTripper, gating requests through a Breaker and
+// feeding the response status back into it: 429/503 call MarkThrottled with the parsed
+// Retry-After header (0 if it is missing or malformed), other server errors and transport
+// failures call MarkFailed, and anything else calls MarkSuccess. The zero value is not usable; construct one with
+// NewRoundTripper.
+type RoundTripper struct {
+	breaker Breaker
+	next    http.RoundTripper
+}
+
+// NewRoundTripper returns a RoundTripper that gates requests through breaker before
+// forwarding them to next. If next is nil, http.DefaultTransport is used.
+func NewRoundTripper(breaker Breaker, next http.RoundTripper) *RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RoundTripper{
+		breaker: breaker,
+		next:    next,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := rt.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		rt.breaker.MarkFailed()
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		rt.breaker.MarkThrottled(parseRetryAfter(resp.Header.Get("Retry-After")))
+	case resp.StatusCode >= 500:
+		rt.breaker.MarkFailed()
+	default:
+		rt.breaker.MarkSuccess()
+	}
+	return resp, nil
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which RFC 9110 allows to be
+// either a number of delta-seconds or an HTTP-date. It returns 0 if v is empty, malformed,
+// or an HTTP-date that has already passed.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0
+	}
+	d := t.Sub(Now())
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,133 @@
+package breakerhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	sre "github.com/yimi-go/sre-circuit-breaker"
+)
+
+type fakeBreaker struct {
+	allowErr   error
+	successes  int
+	fails      int
+	throttled  int
+	retryAfter time.Duration
+}
+
+func (b *fakeBreaker) Allow() error { return b.allowErr }
+func (b *fakeBreaker) MarkSuccess() { b.successes++ }
+func (b *fakeBreaker) MarkFailed()  { b.fails++ }
+func (b *fakeBreaker) MarkThrottled(retryAfter time.Duration) {
+	b.throttled++
+	b.retryAfter = retryAfter
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestRoundTripper_AllowRejects(t *testing.T) {
+	b := &fakeBreaker{allowErr: errors.New("not allowed")}
+	called := false
+	rt := NewRoundTripper(b, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		called = true
+		return nil, nil
+	}))
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Error(t, err)
+	assert.False(t, called)
+}
+
+func TestRoundTripper_TransportErrorMarksFailed(t *testing.T) {
+	b := &fakeBreaker{}
+	rt := NewRoundTripper(b, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("dial tcp: timeout")
+	}))
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Error(t, err)
+	assert.Equal(t, 1, b.fails)
+}
+
+func TestRoundTripper_SuccessStatus(t *testing.T) {
+	b := &fakeBreaker{}
+	rt := NewRoundTripper(b, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, nil
+	}))
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.successes)
+}
+
+func TestRoundTripper_ServerErrorMarksFailed(t *testing.T) {
+	b := &fakeBreaker{}
+	rt := NewRoundTripper(b, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusInternalServerError, Header: http.Header{}}, nil
+	}))
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.fails)
+}
+
+func TestRoundTripper_ThrottledDeltaSeconds(t *testing.T) {
+	b := &fakeBreaker{}
+	header := http.Header{}
+	header.Set("Retry-After", "30")
+	rt := NewRoundTripper(b, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusTooManyRequests, Header: header}, nil
+	}))
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.throttled)
+	assert.Equal(t, 30*time.Second, b.retryAfter)
+}
+
+func TestRoundTripper_ThrottledHTTPDate(t *testing.T) {
+	origNow := Now
+	defer func() { Now = origNow }()
+	base := time.Date(2026, 7, 26, 12, 0, 0, 0, time.UTC)
+	Now = func() time.Time { return base }
+
+	b := &fakeBreaker{}
+	header := http.Header{}
+	header.Set("Retry-After", base.Add(time.Minute).Format(http.TimeFormat))
+	rt := NewRoundTripper(b, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: header}, nil
+	}))
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.throttled)
+	assert.Equal(t, time.Minute, b.retryAfter)
+}
+
+func TestRoundTripper_ThrottledMissingRetryAfter(t *testing.T) {
+	b := &fakeBreaker{}
+	rt := NewRoundTripper(b, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}, nil
+	}))
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.throttled)
+	assert.Equal(t, time.Duration(0), b.retryAfter)
+}
+
+func TestNewRoundTripper_DefaultsNextTransport(t *testing.T) {
+	rt := NewRoundTripper(&fakeBreaker{}, nil)
+	assert.Equal(t, http.DefaultTransport, rt.next)
+}
+
+// TestNewRoundTripper_WithRealBreaker wires sre.New's result straight into
+// NewRoundTripper, the way a real caller would, rather than through fakeBreaker: it
+// catches Breaker interface drift in the sre package that a hand-rolled stand-in can't.
+func TestNewRoundTripper_WithRealBreaker(t *testing.T) {
+	rt := NewRoundTripper(sre.New(), roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,90 @@
+// Package prometheus adapts an sre circuit breaker's lifecycle events to Prometheus
+// metrics, so operators can see when and why the breaker sheds load.
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/yimi-go/sre-circuit-breaker"
+)
+
+// Collector is an sre.Observer that records circuit breaker lifecycle events as
+// Prometheus metrics. The zero value is not usable; construct one with NewCollector.
+type Collector struct {
+	stateTransitions *prometheus.CounterVec
+	marks            *prometheus.CounterVec
+	dropProbability  prometheus.Histogram
+	windowAccepts    prometheus.Gauge
+	windowTotal      prometheus.Gauge
+}
+
+// NewCollector builds a Collector whose metric names are prefixed with namespace, and
+// registers its metrics with reg. reg may be nil, in which case the metrics are not
+// registered with any registry; Collector itself does not implement prometheus.Collector.
+func NewCollector(namespace string, reg prometheus.Registerer) *Collector {
+	c := &Collector{
+		stateTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "circuit_breaker",
+			Name:      "state_transitions_total",
+			Help:      "Total number of circuit breaker state transitions, by from/to state.",
+		}, []string{"from", "to"}),
+		marks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "circuit_breaker",
+			Name:      "marks_total",
+			Help:      "Total number of MarkSuccess/MarkFailed calls, by result.",
+		}, []string{"result"}),
+		dropProbability: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "circuit_breaker",
+			Name:      "drop_probability",
+			Help:      "Distribution of the adaptive throttling drop probability computed by Allow.",
+			Buckets:   prometheus.LinearBuckets(0, 0.1, 10),
+		}),
+		windowAccepts: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "circuit_breaker",
+			Name:      "window_accepts",
+			Help:      "Accepted request count in the current statistics window.",
+		}),
+		windowTotal: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "circuit_breaker",
+			Name:      "window_total",
+			Help:      "Total request count in the current statistics window.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(c.stateTransitions, c.marks, c.dropProbability, c.windowAccepts, c.windowTotal)
+	}
+	return c
+}
+
+// OnStateChange implements sre.Observer.
+func (c *Collector) OnStateChange(from, to sre.State) {
+	c.stateTransitions.WithLabelValues(from.String(), to.String()).Inc()
+}
+
+// OnDrop implements sre.Observer.
+func (c *Collector) OnDrop(probability float64) {
+	c.dropProbability.Observe(probability)
+}
+
+// OnMarkSuccess implements sre.Observer.
+func (c *Collector) OnMarkSuccess() {
+	c.marks.WithLabelValues("success").Inc()
+}
+
+// OnMarkFailed implements sre.Observer.
+func (c *Collector) OnMarkFailed() {
+	c.marks.WithLabelValues("failed").Inc()
+}
+
+// OnSample implements sre.Observer.
+func (c *Collector) OnSample(accepts, total int64) {
+	c.windowAccepts.Set(float64(accepts))
+	c.windowTotal.Set(float64(total))
+}
+
+var _ sre.Observer = (*Collector)(nil)
@@ -0,0 +1,62 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	sre "github.com/yimi-go/sre-circuit-breaker"
+)
+
+func TestCollector_OnStateChange(t *testing.T) {
+	c := NewCollector("test", nil)
+	c.OnStateChange(sre.StateClosed, sre.StateOpen)
+	m := &dto.Metric{}
+	_ = c.stateTransitions.WithLabelValues("closed", "open").Write(m)
+	assert.Equal(t, float64(1), m.Counter.GetValue())
+}
+
+func TestCollector_OnMarkSuccessAndFailed(t *testing.T) {
+	c := NewCollector("test", nil)
+	c.OnMarkSuccess()
+	c.OnMarkFailed()
+	c.OnMarkFailed()
+
+	m := &dto.Metric{}
+	_ = c.marks.WithLabelValues("success").Write(m)
+	assert.Equal(t, float64(1), m.Counter.GetValue())
+
+	m = &dto.Metric{}
+	_ = c.marks.WithLabelValues("failed").Write(m)
+	assert.Equal(t, float64(2), m.Counter.GetValue())
+}
+
+func TestCollector_OnDrop(t *testing.T) {
+	c := NewCollector("test", nil)
+	c.OnDrop(0.5)
+	m := &dto.Metric{}
+	_ = c.dropProbability.Write(m)
+	assert.Equal(t, uint64(1), m.Histogram.GetSampleCount())
+}
+
+func TestCollector_OnSample(t *testing.T) {
+	c := NewCollector("test", nil)
+	c.OnSample(3, 10)
+	m := &dto.Metric{}
+	_ = c.windowAccepts.Write(m)
+	assert.Equal(t, float64(3), m.Gauge.GetValue())
+	m = &dto.Metric{}
+	_ = c.windowTotal.Write(m)
+	assert.Equal(t, float64(10), m.Gauge.GetValue())
+}
+
+func TestNewCollector_Registers(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := NewCollector("test", reg)
+	mfs, err := reg.Gather()
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+	assert.NotEmpty(t, mfs)
+}
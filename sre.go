@@ -1,9 +1,12 @@
 package sre
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/yimi-go/circuit-breaker"
@@ -11,6 +14,149 @@ import (
 	"github.com/yimi-go/window"
 )
 
+var errHalfOpenFlowLimited = errors.New("sre: half-open probe limit exceeded")
+
+// IsErrHalfOpenFlowLimited reports whether err is, or wraps, the error returned by Allow
+// when the half-open probe limit has been reached.
+func IsErrHalfOpenFlowLimited(err error) bool {
+	return errors.Is(err, errHalfOpenFlowLimited)
+}
+
+// ErrHalfOpenFlowLimited returns the sentinel error Allow returns when a half-open probe
+// is shed for exceeding the probe limit, as opposed to circuit_breaker.ErrNotAllowed which
+// signals adaptive-throttling or open-circuit shedding.
+func ErrHalfOpenFlowLimited() error {
+	return errHalfOpenFlowLimited
+}
+
+// Now is the current time function used by the breaker. It is a seam for
+// tests, analogous to window.Now.
+var Now = time.Now
+
+// State is a circuit breaker state.
+type State int32
+
+const (
+	// StateClosed is the normal state: requests flow through and are only
+	// shed by the adaptive throttling math.
+	StateClosed State = iota
+	// StateHalfOpen is the probing state entered after doomDuration has
+	// elapsed in StateOpen.
+	StateHalfOpen
+	// StateOpen is the tripped state: requests are rejected outright.
+	StateOpen
+)
+
+// String implements fmt.Stringer.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Criticality is a request priority tier, following the Google SRE adaptive throttling
+// scheme: lower-criticality traffic is shed more aggressively than higher-criticality
+// traffic as a backend degrades.
+type Criticality int
+
+const (
+	// CriticalitySheddable is dropped first: best-effort traffic that can be shed
+	// freely without user-visible impact.
+	CriticalitySheddable Criticality = iota
+	// CriticalitySheddablePlus is shed before Critical traffic, but after Sheddable.
+	CriticalitySheddablePlus
+	// CriticalityCritical is shed only once Sheddable and SheddablePlus traffic has
+	// already been shed.
+	CriticalityCritical
+	// CriticalityCriticalPlus is shed last: traffic whose failure would itself cause
+	// a cascading outage, e.g. health checks or requests that release other resources.
+	CriticalityCriticalPlus
+)
+
+// String implements fmt.Stringer.
+func (c Criticality) String() string {
+	switch c {
+	case CriticalitySheddable:
+		return "sheddable"
+	case CriticalitySheddablePlus:
+		return "sheddable_plus"
+	case CriticalityCritical:
+		return "critical"
+	case CriticalityCriticalPlus:
+		return "critical_plus"
+	default:
+		return "unknown"
+	}
+}
+
+// Observer receives circuit breaker lifecycle events, for metrics and other
+// observability integrations. Implementations must be safe for concurrent use.
+type Observer interface {
+	// OnStateChange is called whenever the breaker transitions from one State to another.
+	OnStateChange(from, to State)
+	// OnDrop is called with the drop probability computed by Allow/AllowWithCriticality,
+	// whether or not the roll actually dropped the request.
+	OnDrop(probability float64)
+	// OnMarkSuccess is called on every MarkSuccess.
+	OnMarkSuccess()
+	// OnMarkFailed is called on every MarkFailed.
+	OnMarkFailed()
+	// OnSample is called with the current window accepts/total whenever Allow or
+	// AllowWithCriticality evaluates the adaptive throttling math.
+	OnSample(accepts, total int64)
+}
+
+// noopObserver is the zero-value Observer, used when no Observer is configured so the
+// breaker never needs a nil check.
+type noopObserver struct{}
+
+func (noopObserver) OnStateChange(State, State) {}
+func (noopObserver) OnDrop(float64)             {}
+func (noopObserver) OnMarkSuccess()             {}
+func (noopObserver) OnMarkFailed()              {}
+func (noopObserver) OnSample(int64, int64)      {}
+
+// fanOutObserver broadcasts every event to a set of observers, so WithObserver can be
+// passed more than once.
+type fanOutObserver []Observer
+
+func (f fanOutObserver) OnStateChange(from, to State) {
+	for _, o := range f {
+		o.OnStateChange(from, to)
+	}
+}
+
+func (f fanOutObserver) OnDrop(probability float64) {
+	for _, o := range f {
+		o.OnDrop(probability)
+	}
+}
+
+func (f fanOutObserver) OnMarkSuccess() {
+	for _, o := range f {
+		o.OnMarkSuccess()
+	}
+}
+
+func (f fanOutObserver) OnMarkFailed() {
+	for _, o := range f {
+		o.OnMarkFailed()
+	}
+}
+
+func (f fanOutObserver) OnSample(accepts, total int64) {
+	for _, o := range f {
+		o.OnSample(accepts, total)
+	}
+}
+
 // Option is sre breaker option function.
 type Option func(*options)
 
@@ -25,6 +171,18 @@ type options struct {
 	buckets int
 	// The max duration of a bucket.
 	requireBucketDuration time.Duration
+	// How long the failure condition must persist before the breaker trips Closed -> Open.
+	graceDuration time.Duration
+	// How long the breaker stays Open before switching to HalfOpen for probing.
+	doomDuration time.Duration
+	// The max number of probe requests admitted in-flight while HalfOpen.
+	halfOpenProbeLimit int64
+	// The drop probability multiplier used by AllowWithCriticality for each tier.
+	criticalityMultipliers map[Criticality]float64
+	// The observers registered via WithObserver.
+	observers []Observer
+	// The max cooldown duration MarkThrottled will honour.
+	maxRetryAfter time.Duration
 }
 
 // WithInspirationSuccessRate sets the inspiration success rate (ISR) of the circuit breaker.
@@ -60,27 +218,153 @@ func WithBuckets(buckets int) Option {
 	}
 }
 
+// WithGraceDuration sets how long a continuous failure streak must persist before the
+// breaker trips from StateClosed to StateOpen.
+func WithGraceDuration(d time.Duration) Option {
+	return func(o *options) {
+		o.graceDuration = d
+	}
+}
+
+// WithDoomDuration sets how long the breaker stays in StateOpen before it switches to
+// StateHalfOpen and admits a probe request.
+func WithDoomDuration(d time.Duration) Option {
+	return func(o *options) {
+		o.doomDuration = d
+	}
+}
+
+// WithHalfOpenProbeLimit sets how many probe requests may be in-flight at once while the
+// breaker is in StateHalfOpen. Default is 1.
+func WithHalfOpenProbeLimit(n int) Option {
+	return func(o *options) {
+		o.halfOpenProbeLimit = int64(n)
+	}
+}
+
+// WithCriticalityMultiplier sets the drop probability multiplier AllowWithCriticality uses
+// for tier c. Larger values shed tier c more aggressively; smaller values (down to 1.0)
+// shed it less. Defaults are CriticalitySheddable=2.0, CriticalitySheddablePlus=1.5,
+// CriticalityCritical=1.1, CriticalityCriticalPlus=1.0.
+func WithCriticalityMultiplier(c Criticality, k float64) Option {
+	return func(o *options) {
+		o.criticalityMultipliers[c] = k
+	}
+}
+
+// WithObserver registers an Observer to receive the breaker's lifecycle events. It may be
+// passed more than once; all registered observers are notified of every event.
+func WithObserver(ob Observer) Option {
+	return func(o *options) {
+		o.observers = append(o.observers, ob)
+	}
+}
+
+// WithMaxRetryAfter caps the cooldown duration MarkThrottled will honour, so an adversarial
+// or misbehaving backend can't arm an unbounded cooldown. Default is 60 seconds.
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(o *options) {
+		o.maxRetryAfter = d
+	}
+}
+
 type breaker struct {
+	// statMu guards stat itself (not its internal bucket bookkeeping, which the
+	// window.Window implementation already synchronizes): Restore replaces stat
+	// wholesale, so readers need a consistent view of which window they're using.
+	statMu    sync.RWMutex
 	stat      window.Window
 	rnd       sync.Pool
 	dropProba func(r *rand.Rand, proba float64) bool
 
 	isr            float64
 	ignoreRequests int64
+
+	graceDuration time.Duration
+	doomDuration  time.Duration
+
+	// state is a State, accessed atomically.
+	state int32
+	// failingSinceMillis is the unix milli timestamp of the first failure of the
+	// current failure streak, or math.MaxInt64 while the streak is unbroken by success.
+	failingSinceMillis int64
+	// openedSinceMillis is the unix milli timestamp at which the breaker last
+	// entered StateOpen.
+	openedSinceMillis int64
+	// halfOpenProbeLimit is the max number of probe requests admitted in-flight
+	// while in StateHalfOpen.
+	halfOpenProbeLimit int64
+	// halfOpenInFlight counts the probe requests currently admitted in StateHalfOpen.
+	halfOpenInFlight int64
+	// criticalityMultipliers holds the per-tier drop probability multiplier used by
+	// AllowWithCriticality. It is populated once at construction and never written to
+	// afterwards, so it's safe for concurrent reads without a lock.
+	criticalityMultipliers map[Criticality]float64
+	// observer is notified of lifecycle events. Defaults to noopObserver{}.
+	observer Observer
+	// maxRetryAfter caps the cooldown duration MarkThrottled will honour.
+	maxRetryAfter time.Duration
+	// cooldownUntilMillis is the unix milli timestamp before which Allow rejects every
+	// request unconditionally, armed by MarkThrottled.
+	cooldownUntilMillis int64
+
+	lastErrMu sync.Mutex
+	lastErr   error
 }
 
+// Breaker is the sre circuit breaker's full public surface: the narrow
+// circuit_breaker.CircuitBreaker every caller gets from New, plus the sre-specific
+// extensions (State, LastError, AllowWithCriticality, Done, MarkThrottled,
+// Snapshot/Restore) that a caller needs a wider static type to reach. Code that only
+// needs the narrow surface can still assign a Breaker to a circuit_breaker.CircuitBreaker
+// variable.
+type Breaker interface {
+	circuit_breaker.CircuitBreaker
+	// State returns the breaker's current state.
+	State() State
+	// LastError returns the error that caused the most recent Allow rejection.
+	LastError() error
+	// AllowWithCriticality is Allow with an explicit request priority tier.
+	AllowWithCriticality(c Criticality) error
+	// Done releases a half-open probe admitted by Allow/AllowWithCriticality and then
+	// records err as MarkFailed/MarkSuccess would.
+	Done(err error)
+	// MarkThrottled records server-side throttling feedback.
+	MarkThrottled(retryAfter time.Duration)
+	// Snapshot dumps the rolling window, state and cooldown deadlines for later Restore.
+	Snapshot() Snapshot
+	// Restore reloads state previously captured by Snapshot.
+	Restore(snap Snapshot) error
+}
+
+var _ Breaker = (*breaker)(nil)
+
 // New returns a sre circuit breaker by options.
-func New(opts ...Option) circuit_breaker.CircuitBreaker {
+func New(opts ...Option) Breaker {
 	opt := options{
 		isr:                   0.5,
 		ignoreRequests:        100,
 		buckets:               10,
 		requireBucketDuration: time.Duration(1 << 28),
+		graceDuration:         5 * time.Second,
+		doomDuration:          30 * time.Second,
+		halfOpenProbeLimit:    1,
+		criticalityMultipliers: map[Criticality]float64{
+			CriticalitySheddable:     2.0,
+			CriticalitySheddablePlus: 1.5,
+			CriticalityCritical:      1.1,
+			CriticalityCriticalPlus:  1.0,
+		},
+		maxRetryAfter: 60 * time.Second,
 	}
 	for _, o := range opts {
 		o(&opt)
 	}
 	stat := window.NewWindow(opt.buckets, opt.requireBucketDuration)
+	var observer Observer = noopObserver{}
+	if len(opt.observers) > 0 {
+		observer = fanOutObserver(opt.observers)
+	}
 	return &breaker{
 		stat: stat,
 		rnd: sync.Pool{
@@ -91,11 +375,26 @@ func New(opts ...Option) circuit_breaker.CircuitBreaker {
 		dropProba: func(r *rand.Rand, proba float64) bool {
 			return r.Float64() < proba
 		},
-		ignoreRequests: opt.ignoreRequests,
-		isr:            opt.isr,
+		ignoreRequests:         opt.ignoreRequests,
+		isr:                    opt.isr,
+		graceDuration:          opt.graceDuration,
+		doomDuration:           opt.doomDuration,
+		halfOpenProbeLimit:     opt.halfOpenProbeLimit,
+		criticalityMultipliers: opt.criticalityMultipliers,
+		observer:               observer,
+		maxRetryAfter:          opt.maxRetryAfter,
+		failingSinceMillis:     math.MaxInt64,
 	}
 }
 
+// currentStat returns the window currently backing the breaker's statistics, so callers
+// don't race with a concurrent Restore replacing it.
+func (b *breaker) currentStat() window.Window {
+	b.statMu.RLock()
+	defer b.statMu.RUnlock()
+	return b.stat
+}
+
 func (b *breaker) summary() (success int64, total int64) {
 	//b.stat.Aggregation(0).Reduce(func(data []int64) {
 	//	total += int64(len(data))
@@ -103,35 +402,318 @@ func (b *breaker) summary() (success int64, total int64) {
 	//		success += data[i]
 	//	}
 	//})
-	total = b.stat.Aggregation(0).Count()
-	success = b.stat.Aggregation(0).Sum()
+	stat := b.currentStat()
+	total = stat.Aggregation(0).Count()
+	success = stat.Aggregation(0).Sum()
 	return
 }
 
+// State returns the breaker's current state. It is computed lazily, so calling it does
+// not by itself drive a Closed -> Open -> HalfOpen transition; call Allow to do that.
+func (b *breaker) State() State {
+	return State(atomic.LoadInt32(&b.state))
+}
+
+// LastError returns the error that caused the most recent Allow rejection, or nil if the
+// breaker has never rejected a request.
+func (b *breaker) LastError() error {
+	b.lastErrMu.Lock()
+	defer b.lastErrMu.Unlock()
+	return b.lastErr
+}
+
+func (b *breaker) setLastError(err error) {
+	b.lastErrMu.Lock()
+	defer b.lastErrMu.Unlock()
+	b.lastErr = err
+}
+
+// checkState drives the time-based Closed -> Open -> HalfOpen transitions.
+func (b *breaker) checkState() {
+	now := Now().UnixMilli()
+	switch State(atomic.LoadInt32(&b.state)) {
+	case StateClosed:
+		since := atomic.LoadInt64(&b.failingSinceMillis)
+		if since != math.MaxInt64 && now-since > b.graceDuration.Milliseconds() {
+			if atomic.CompareAndSwapInt32(&b.state, int32(StateClosed), int32(StateOpen)) {
+				atomic.StoreInt64(&b.openedSinceMillis, now)
+				b.observer.OnStateChange(StateClosed, StateOpen)
+			}
+		}
+	case StateOpen:
+		openedSince := atomic.LoadInt64(&b.openedSinceMillis)
+		if now-openedSince > b.doomDuration.Milliseconds() {
+			if atomic.CompareAndSwapInt32(&b.state, int32(StateOpen), int32(StateHalfOpen)) {
+				atomic.StoreInt64(&b.halfOpenInFlight, 0)
+				b.observer.OnStateChange(StateOpen, StateHalfOpen)
+			}
+		}
+	}
+}
+
+// reject records and returns the ErrNotAllowed sentinel.
+func (b *breaker) reject() error {
+	err := circuit_breaker.ErrNotAllowed()
+	b.setLastError(err)
+	return err
+}
+
+// admitHalfOpenProbe applies the half-open probe admission policy: it admits up to
+// halfOpenProbeLimit in-flight probes and sheds the rest with ErrHalfOpenFlowLimited.
+func (b *breaker) admitHalfOpenProbe() error {
+	limit := atomic.LoadInt64(&b.halfOpenProbeLimit)
+	for {
+		inFlight := atomic.LoadInt64(&b.halfOpenInFlight)
+		if inFlight >= limit {
+			err := ErrHalfOpenFlowLimited()
+			b.setLastError(err)
+			return err
+		}
+		if atomic.CompareAndSwapInt64(&b.halfOpenInFlight, inFlight, inFlight+1) {
+			return nil
+		}
+	}
+}
+
+// dropOrAllow rolls the dice against the given drop probability, recording and returning
+// ErrNotAllowed when the roll sheds the request.
+func (b *breaker) dropOrAllow(dr float64) error {
+	b.observer.OnDrop(dr)
+	rnd := b.rnd.Get().(*rand.Rand)
+	defer func() {
+		b.rnd.Put(rnd)
+	}()
+	if b.dropProba(rnd, dr) {
+		return b.reject()
+	}
+	return nil
+}
+
+// Allow decides whether to admit a request using the original ISR-based formula (see
+// WithInspirationSuccessRate), unaware of request priority. It predates criticality
+// tiers and is kept as-is for existing callers: AllowWithCriticality is a separate,
+// additive formula for callers that do distinguish request priority, not a superset of
+// Allow, so the two can disagree on the same accepts/total. A caller that wants
+// criticality-aware throttling should call AllowWithCriticality directly rather than
+// relying on Allow to pick a tier for it.
 func (b *breaker) Allow() error {
+	b.checkState()
+	if b.inCooldown() {
+		return b.reject()
+	}
+	switch State(atomic.LoadInt32(&b.state)) {
+	case StateOpen:
+		return b.reject()
+	case StateHalfOpen:
+		return b.admitHalfOpenProbe()
+	}
 	// The number of requests accepted by the backend and the number of requests sent to backend.
 	accepts, total := b.summary()
+	b.observer.OnSample(accepts, total)
 	// The inspiration requests number.
 	inspirationRequests := float64(accepts) / b.isr
 	if total < b.ignoreRequests || float64(total) < inspirationRequests {
 		return nil
 	}
 	dr := math.Max(0, (float64(total)-inspirationRequests)/float64(total+1))
-	rnd := b.rnd.Get().(*rand.Rand)
-	defer func() {
-		b.rnd.Put(rnd)
-	}()
-	drop := b.dropProba(rnd, dr)
-	if drop {
-		return circuit_breaker.ErrNotAllowed()
+	return b.dropOrAllow(dr)
+}
+
+// AllowWithCriticality is like Allow, but sheds requests according to a per-criticality
+// drop probability instead of the fixed ISR used by Allow. Higher-criticality tiers (e.g.
+// CriticalityCriticalPlus) use a smaller multiplier and are shed less readily than
+// lower-criticality tiers (e.g. CriticalitySheddable), so low-priority traffic is throttled
+// before high-priority traffic as the backend degrades.
+func (b *breaker) AllowWithCriticality(c Criticality) error {
+	b.checkState()
+	if b.inCooldown() {
+		return b.reject()
+	}
+	switch State(atomic.LoadInt32(&b.state)) {
+	case StateOpen:
+		return b.reject()
+	case StateHalfOpen:
+		return b.admitHalfOpenProbe()
+	}
+	accepts, total := b.summary()
+	b.observer.OnSample(accepts, total)
+	if total < b.ignoreRequests {
+		return nil
+	}
+	k := b.criticalityMultiplier(c)
+	dr := math.Max(0, (float64(total)*k-float64(accepts))/float64(total+1))
+	return b.dropOrAllow(dr)
+}
+
+func (b *breaker) criticalityMultiplier(c Criticality) float64 {
+	if k, ok := b.criticalityMultipliers[c]; ok {
+		return k
+	}
+	return 1.0
+}
+
+// releaseHalfOpenProbe decrements the half-open in-flight counter by one, if it's above
+// zero. MarkSuccess and MarkFailed call it for every probe outcome, not just the one
+// that happens to win the HalfOpen -> Closed/Open transition race, so a probe's slot is
+// freed as soon as that probe completes rather than only when the whole state machine
+// transitions.
+func (b *breaker) releaseHalfOpenProbe() {
+	for {
+		inFlight := atomic.LoadInt64(&b.halfOpenInFlight)
+		if inFlight <= 0 {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&b.halfOpenInFlight, inFlight, inFlight-1) {
+			return
+		}
 	}
-	return nil
 }
 
 func (b *breaker) MarkSuccess() {
-	b.stat.Add(1)
+	b.currentStat().Add(1)
+	b.observer.OnMarkSuccess()
+	atomic.StoreInt64(&b.failingSinceMillis, math.MaxInt64)
+	if State(atomic.LoadInt32(&b.state)) == StateHalfOpen {
+		b.releaseHalfOpenProbe()
+		if atomic.CompareAndSwapInt32(&b.state, int32(StateHalfOpen), int32(StateClosed)) {
+			b.observer.OnStateChange(StateHalfOpen, StateClosed)
+		}
+	}
 }
 
 func (b *breaker) MarkFailed() {
-	b.stat.Add(0)
+	b.currentStat().Add(0)
+	b.observer.OnMarkFailed()
+	now := Now().UnixMilli()
+	atomic.CompareAndSwapInt64(&b.failingSinceMillis, math.MaxInt64, now)
+	if State(atomic.LoadInt32(&b.state)) == StateHalfOpen {
+		b.releaseHalfOpenProbe()
+		if atomic.CompareAndSwapInt32(&b.state, int32(StateHalfOpen), int32(StateOpen)) {
+			// A failed probe resets the doom clock.
+			atomic.StoreInt64(&b.openedSinceMillis, now)
+			b.observer.OnStateChange(StateHalfOpen, StateOpen)
+		}
+	}
+}
+
+// inCooldown reports whether the breaker is within a cooldown window armed by a prior
+// MarkThrottled call, during which Allow and AllowWithCriticality reject unconditionally.
+func (b *breaker) inCooldown() bool {
+	return Now().UnixMilli() < atomic.LoadInt64(&b.cooldownUntilMillis)
+}
+
+// MarkThrottled reports that the backend itself rejected the request as overloaded (e.g. HTTP
+// 429/503), and asked the caller to wait retryAfter before retrying. It is treated as a failure
+// for the purposes of the accepts/total ratio and the HalfOpen/Open state machine, exactly like
+// MarkFailed, but additionally arms a cooldown window during which Allow and
+// AllowWithCriticality reject every request unconditionally, bypassing the probabilistic
+// throttling formula entirely. retryAfter is clamped to [0, maxRetryAfter] so a misbehaving or
+// adversarial backend can't force an unbounded cooldown.
+func (b *breaker) MarkThrottled(retryAfter time.Duration) {
+	if retryAfter < 0 {
+		retryAfter = 0
+	} else if retryAfter > b.maxRetryAfter {
+		retryAfter = b.maxRetryAfter
+	}
+	now := Now()
+	atomic.StoreInt64(&b.cooldownUntilMillis, now.Add(retryAfter).UnixMilli())
+	b.MarkFailed()
+}
+
+// Done reports the outcome of a request that Allow previously admitted, by calling
+// MarkSuccess/MarkFailed, which themselves release the half-open probe slot (if one was
+// held) and drive the HalfOpen -> Closed or HalfOpen -> Open transition. It's a thin,
+// defer-friendly spelling of that same call so a panicking request still releases its
+// probe slot.
+func (b *breaker) Done(err error) {
+	if err == nil {
+		b.MarkSuccess()
+		return
+	}
+	b.MarkFailed()
+}
+
+// SnapshotVersion is the current encoding version of Snapshot. Restore rejects a
+// Snapshot whose Version doesn't match, so a future incompatible layout change can be
+// detected instead of silently misread.
+const SnapshotVersion = 1
+
+// BucketSnapshot is the accepts/total counts recorded in a single statistics window
+// bucket.
+type BucketSnapshot struct {
+	Accepts int64 `json:"accepts"`
+	Total   int64 `json:"total"`
+}
+
+// Snapshot is a stable, versioned dump of a breaker's rolling window and state machine,
+// suitable for JSON or protobuf encoding across a warm restart, or for publishing to
+// another instance via the sre/sync sub-package. Buckets are ordered oldest to newest.
+type Snapshot struct {
+	Version             int              `json:"version"`
+	Buckets             []BucketSnapshot `json:"buckets"`
+	BucketDurationNanos int64            `json:"bucket_duration_nanos"`
+	State               State            `json:"state"`
+	FailingSinceMillis  int64            `json:"failing_since_millis"`
+	OpenedSinceMillis   int64            `json:"opened_since_millis"`
+	CooldownUntilMillis int64            `json:"cooldown_until_millis"`
+}
+
+// Snapshot dumps the breaker's rolling window buckets, current state and cooldown
+// deadlines. The result can be persisted and later fed to Restore, e.g. by a process
+// that's about to restart, so the replacement doesn't cold-start with an empty window.
+func (b *breaker) Snapshot() Snapshot {
+	stat := b.currentStat()
+	var buckets []BucketSnapshot
+	stat.Aggregation(0).Reduce(func(bucket window.Bucket) (done bool) {
+		var accepts int64
+		for _, v := range bucket.Data() {
+			accepts += v
+		}
+		buckets = append(buckets, BucketSnapshot{Accepts: accepts, Total: bucket.Count()})
+		return false
+	})
+	return Snapshot{
+		Version:             SnapshotVersion,
+		Buckets:             buckets,
+		BucketDurationNanos: int64(stat.BucketDuration()),
+		State:               State(atomic.LoadInt32(&b.state)),
+		FailingSinceMillis:  atomic.LoadInt64(&b.failingSinceMillis),
+		OpenedSinceMillis:   atomic.LoadInt64(&b.openedSinceMillis),
+		CooldownUntilMillis: atomic.LoadInt64(&b.cooldownUntilMillis),
+	}
+}
+
+// Restore reloads state previously captured by Snapshot. It first replaces the
+// breaker's rolling window with a freshly constructed, empty one of the same bucket
+// count and duration, then replays each snapshotted bucket's accepts/total counts into
+// it via Add, so the restored history lands on top of nothing rather than on top of
+// whatever the breaker had already accumulated; a second Restore of the same Snapshot
+// therefore reloads the same counts rather than doubling them. Because the underlying
+// window only exposes Add/Append for the bucket Now() falls in, the original per-bucket
+// time distribution can't be reproduced exactly, but the aggregate accepts/total counts
+// are. Restore returns an error if snap.Version isn't one this breaker understands.
+func (b *breaker) Restore(snap Snapshot) error {
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("sre: unsupported snapshot version %d", snap.Version)
+	}
+	b.statMu.Lock()
+	stat := window.NewWindow(int(b.stat.BucketNum()), b.stat.BucketDuration())
+	b.stat = stat
+	b.statMu.Unlock()
+	for _, bucket := range snap.Buckets {
+		fails := bucket.Total - bucket.Accepts
+		for i := int64(0); i < bucket.Accepts; i++ {
+			stat.Add(1)
+		}
+		for i := int64(0); i < fails; i++ {
+			stat.Add(0)
+		}
+	}
+	if from := State(atomic.SwapInt32(&b.state, int32(snap.State))); from != snap.State {
+		b.observer.OnStateChange(from, snap.State)
+	}
+	atomic.StoreInt64(&b.failingSinceMillis, snap.FailingSinceMillis)
+	atomic.StoreInt64(&b.openedSinceMillis, snap.OpenedSinceMillis)
+	atomic.StoreInt64(&b.cooldownUntilMillis, snap.CooldownUntilMillis)
+	return nil
 }
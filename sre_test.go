@@ -1,14 +1,17 @@
 package sre
 
 import (
+	"errors"
 	"math"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/yimi-go/circuit-breaker"
 	"github.com/yimi-go/window"
 )
 
@@ -32,6 +35,19 @@ func getSREBreaker() *breaker {
 
 		ignoreRequests: 100,
 		isr:            0.5,
+
+		graceDuration:      5 * time.Second,
+		doomDuration:       30 * time.Second,
+		halfOpenProbeLimit: 1,
+		failingSinceMillis: math.MaxInt64,
+		criticalityMultipliers: map[Criticality]float64{
+			CriticalitySheddable:     2.0,
+			CriticalitySheddablePlus: 1.5,
+			CriticalityCritical:      1.1,
+			CriticalityCriticalPlus:  1.0,
+		},
+		observer:      noopObserver{},
+		maxRetryAfter: 60 * time.Second,
 	}
 }
 
@@ -288,3 +304,540 @@ func Test_dropProba(t *testing.T) {
 	markFailed(b, 10000)
 	assert.Equal(t, b.Allow(), nil)
 }
+
+func TestState_String(t *testing.T) {
+	tests := []struct {
+		state State
+		want  string
+	}{
+		{StateClosed, "closed"},
+		{StateHalfOpen, "half-open"},
+		{StateOpen, "open"},
+		{State(99), "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.state.String())
+		})
+	}
+}
+
+func TestWithGraceDuration(t *testing.T) {
+	o := &options{}
+	d := time.Second
+	WithGraceDuration(d)(o)
+	if o.graceDuration != d {
+		t.Errorf("want %v, got %v", d, o.graceDuration)
+	}
+}
+
+func TestWithDoomDuration(t *testing.T) {
+	o := &options{}
+	d := time.Second
+	WithDoomDuration(d)(o)
+	if o.doomDuration != d {
+		t.Errorf("want %v, got %v", d, o.doomDuration)
+	}
+}
+
+func TestBreaker_StateMachine(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	b.graceDuration = 100 * time.Millisecond
+	b.doomDuration = 200 * time.Millisecond
+
+	assert.Equal(t, StateClosed, b.State())
+	assert.Nil(t, b.LastError())
+
+	b.MarkFailed()
+	assert.Equal(t, StateClosed, b.State())
+
+	now = now.Add(200 * time.Millisecond)
+	assert.Error(t, b.Allow())
+	assert.Equal(t, StateOpen, b.State())
+	assert.Error(t, b.LastError())
+
+	now = now.Add(300 * time.Millisecond)
+	assert.NoError(t, b.Allow())
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	b.MarkSuccess()
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreaker_StateMachine_FailedProbeReopens(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	b.graceDuration = 100 * time.Millisecond
+	b.doomDuration = 200 * time.Millisecond
+
+	b.MarkFailed()
+	now = now.Add(200 * time.Millisecond)
+	assert.Error(t, b.Allow())
+	now = now.Add(300 * time.Millisecond)
+	assert.NoError(t, b.Allow())
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	b.MarkFailed()
+	assert.Equal(t, StateOpen, b.State())
+	assert.Error(t, b.Allow())
+}
+
+func TestWithHalfOpenProbeLimit(t *testing.T) {
+	o := &options{}
+	WithHalfOpenProbeLimit(3)(o)
+	if o.halfOpenProbeLimit != 3 {
+		t.Errorf("want 3, got %v", o.halfOpenProbeLimit)
+	}
+}
+
+func TestBreaker_HalfOpenProbeLimit(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	b.graceDuration = 100 * time.Millisecond
+	b.doomDuration = 200 * time.Millisecond
+	b.halfOpenProbeLimit = 2
+
+	b.MarkFailed()
+	now = now.Add(200 * time.Millisecond)
+	assert.Error(t, b.Allow())
+	now = now.Add(300 * time.Millisecond)
+
+	// The modulo half-open admission pattern: with a probe limit of 2, the first
+	// two callers are admitted and the third is shed for probing budget, distinct
+	// from an adaptively-throttled rejection.
+	assert.NoError(t, b.Allow())
+	assert.NoError(t, b.Allow())
+	err := b.Allow()
+	assert.Error(t, err)
+	assert.True(t, IsErrHalfOpenFlowLimited(err))
+	assert.False(t, circuit_breaker.IsErrNotAllowed(err))
+
+	b.Done(nil)
+	assert.NoError(t, b.Allow())
+}
+
+func TestBreaker_Done_NoInFlightLeakOnPanic(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	b.graceDuration = 100 * time.Millisecond
+	b.doomDuration = 200 * time.Millisecond
+	b.halfOpenProbeLimit = 1
+
+	b.MarkFailed()
+	now = now.Add(200 * time.Millisecond)
+	assert.Error(t, b.Allow())
+	now = now.Add(300 * time.Millisecond)
+
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		defer b.Done(errors.New("boom"))
+		assert.NoError(t, b.Allow())
+		panic("simulated request panic")
+	}()
+
+	assert.Equal(t, int64(0), b.halfOpenInFlight)
+}
+
+func TestBreaker_MarkFailed_ReleasesHalfOpenProbeWithoutDone(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	b.graceDuration = 100 * time.Millisecond
+	b.doomDuration = 200 * time.Millisecond
+	b.halfOpenProbeLimit = 2
+
+	b.MarkFailed()
+	now = now.Add(200 * time.Millisecond)
+	assert.Error(t, b.Allow())
+	now = now.Add(300 * time.Millisecond)
+
+	assert.NoError(t, b.Allow())
+	assert.NoError(t, b.Allow())
+
+	// A caller using only the narrow Allow/MarkSuccess/MarkFailed surface (no Done)
+	// must still see its own probe's slot released when it reports failure, even
+	// though a second probe admitted alongside it is still in flight.
+	b.MarkFailed()
+	assert.Equal(t, int64(1), b.halfOpenInFlight)
+}
+
+func TestCriticality_String(t *testing.T) {
+	tests := []struct {
+		c    Criticality
+		want string
+	}{
+		{CriticalitySheddable, "sheddable"},
+		{CriticalitySheddablePlus, "sheddable_plus"},
+		{CriticalityCritical, "critical"},
+		{CriticalityCriticalPlus, "critical_plus"},
+		{Criticality(99), "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.c.String())
+		})
+	}
+}
+
+func TestWithCriticalityMultiplier(t *testing.T) {
+	o := &options{criticalityMultipliers: map[Criticality]float64{}}
+	WithCriticalityMultiplier(CriticalitySheddable, 3.0)(o)
+	if o.criticalityMultipliers[CriticalitySheddable] != 3.0 {
+		t.Errorf("want 3.0, got %v", o.criticalityMultipliers[CriticalitySheddable])
+	}
+}
+
+func TestBreaker_AllowWithCriticality(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	t.Run("below ignore threshold always allowed", func(t *testing.T) {
+		b := getSREBreaker()
+		markFailed(b, 99)
+		assert.NoError(t, b.AllowWithCriticality(CriticalitySheddable))
+	})
+
+	t.Run("sheddable tier is shed before critical_plus at the same ratio", func(t *testing.T) {
+		b := getSREBreaker()
+		markSuccess(b, 60)
+		markFailed(b, 140)
+		// CriticalityCriticalPlus (k=1.0): dr = max(0, (200*1.0-60)/201) ~= 0.70.
+		// CriticalitySheddable (k=2.0): dr = max(0, (200*2.0-60)/201) ~= 1.69 -> clamped to 1 by dropProba.
+		var sheddableDrops, criticalPlusDrops int
+		for i := 0; i < 200; i++ {
+			if b.AllowWithCriticality(CriticalitySheddable) != nil {
+				sheddableDrops++
+			}
+			if b.AllowWithCriticality(CriticalityCriticalPlus) != nil {
+				criticalPlusDrops++
+			}
+		}
+		assert.Greater(t, sheddableDrops, criticalPlusDrops)
+	})
+
+	t.Run("unconfigured tier falls back to no extra throttling", func(t *testing.T) {
+		b := getSREBreaker()
+		b.criticalityMultipliers = map[Criticality]float64{}
+		markSuccess(b, 200)
+		assert.NoError(t, b.AllowWithCriticality(CriticalityCritical))
+	})
+}
+
+// TestBreaker_Allow_UsesItsOwnISRFormulaNotCriticality guards the fact that Allow and
+// AllowWithCriticality are two independent formulas, not one default-tier call routed
+// through the other: a request mix that AllowWithCriticality(CriticalityCritical) would
+// already start shedding leaves Allow, which only consults ISR, still wide open.
+func TestBreaker_Allow_UsesItsOwnISRFormulaNotCriticality(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	markSuccess(b, 200)
+	assert.NoError(t, b.Allow())
+
+	b = getSREBreaker()
+	markSuccess(b, 60)
+	markFailed(b, 140)
+	// ISR=0.5: inspirationRequests = 60/0.5 = 120 < total(200), so Allow does compute a
+	// drop probability here, but a lower one than AllowWithCriticality(CriticalityCritical)
+	// would for the same accepts/total.
+	allowDrops, criticalDrops := 0, 0
+	for i := 0; i < 500; i++ {
+		if b.Allow() != nil {
+			allowDrops++
+		}
+		if b.AllowWithCriticality(CriticalityCritical) != nil {
+			criticalDrops++
+		}
+	}
+	assert.Less(t, allowDrops, criticalDrops)
+}
+
+type recordingObserver struct {
+	mu          sync.Mutex
+	transitions [][2]State
+	drops       []float64
+	successes   int
+	fails       int
+	samples     [][2]int64
+}
+
+func (r *recordingObserver) OnStateChange(from, to State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transitions = append(r.transitions, [2]State{from, to})
+}
+
+func (r *recordingObserver) OnDrop(probability float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.drops = append(r.drops, probability)
+}
+
+func (r *recordingObserver) OnMarkSuccess() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.successes++
+}
+
+func (r *recordingObserver) OnMarkFailed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fails++
+}
+
+func (r *recordingObserver) OnSample(accepts, total int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples = append(r.samples, [2]int64{accepts, total})
+}
+
+func TestBreaker_Observer(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	ob := &recordingObserver{}
+	b := getSREBreaker()
+	b.graceDuration = 100 * time.Millisecond
+	b.doomDuration = 200 * time.Millisecond
+	b.observer = ob
+
+	b.MarkFailed()
+	assert.Equal(t, 1, ob.fails)
+
+	now = now.Add(200 * time.Millisecond)
+	assert.Error(t, b.Allow())
+	assert.Contains(t, ob.transitions, [2]State{StateClosed, StateOpen})
+
+	now = now.Add(300 * time.Millisecond)
+	assert.NoError(t, b.Allow())
+	assert.Contains(t, ob.transitions, [2]State{StateOpen, StateHalfOpen})
+
+	b.MarkSuccess()
+	assert.Equal(t, 1, ob.successes)
+	assert.Contains(t, ob.transitions, [2]State{StateHalfOpen, StateClosed})
+
+	markSuccess(b, 200)
+	markFailed(b, 10000)
+	_ = b.Allow()
+	assert.NotEmpty(t, ob.samples)
+	assert.NotEmpty(t, ob.drops)
+}
+
+func TestWithObserver_FanOut(t *testing.T) {
+	obA := &recordingObserver{}
+	obB := &recordingObserver{}
+	b := New(WithObserver(obA), WithObserver(obB)).(*breaker)
+	b.MarkFailed()
+	assert.Equal(t, 1, obA.fails)
+	assert.Equal(t, 1, obB.fails)
+}
+
+func TestWithMaxRetryAfter(t *testing.T) {
+	o := &options{}
+	WithMaxRetryAfter(10 * time.Second)(o)
+	if o.maxRetryAfter != 10*time.Second {
+		t.Errorf("want 10s, got %v", o.maxRetryAfter)
+	}
+}
+
+func TestBreaker_MarkThrottled_ArmsCooldown(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	b.graceDuration = time.Minute
+	b.MarkThrottled(5 * time.Second)
+	assert.Error(t, b.Allow())
+
+	now = now.Add(4 * time.Second)
+	assert.Error(t, b.Allow())
+
+	now = now.Add(2 * time.Second)
+	assert.NoError(t, b.Allow())
+}
+
+func TestBreaker_MarkThrottled_ClampsToMaxRetryAfter(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	b.maxRetryAfter = time.Second
+	b.MarkThrottled(time.Hour)
+
+	now = now.Add(time.Second)
+	assert.NoError(t, b.Allow())
+}
+
+func TestBreaker_MarkThrottled_ReopensHalfOpen(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	b.graceDuration = 100 * time.Millisecond
+	b.doomDuration = 200 * time.Millisecond
+
+	b.MarkFailed()
+	now = now.Add(200 * time.Millisecond)
+	assert.Error(t, b.Allow())
+	now = now.Add(300 * time.Millisecond)
+	assert.NoError(t, b.Allow())
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	b.MarkThrottled(time.Minute)
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestBreaker_SnapshotRestore_RoundTrip(t *testing.T) {
+	originNowFn := Now
+	originWindowNowFn := window.Now
+	defer func() {
+		Now = originNowFn
+		window.Now = originWindowNowFn
+	}()
+	now = time.Now()
+	Now = func() time.Time { return now }
+	window.Now = func() time.Time { return now }
+
+	b := getSREBreaker()
+	markSuccess(b, 60)
+	markFailed(b, 40)
+	b.MarkThrottled(10 * time.Second)
+
+	snap := b.Snapshot()
+	assert.Equal(t, SnapshotVersion, snap.Version)
+	assert.Equal(t, StateClosed, snap.State)
+	assert.NotZero(t, snap.CooldownUntilMillis)
+
+	var accepts, total int64
+	for _, bucket := range snap.Buckets {
+		accepts += bucket.Accepts
+		total += bucket.Total
+	}
+	assert.Equal(t, int64(60), accepts)
+	assert.Equal(t, int64(101), total)
+
+	restored := getSREBreaker()
+	assert.NoError(t, restored.Restore(snap))
+	a, tot := restored.summary()
+	assert.Equal(t, accepts, a)
+	assert.Equal(t, total, tot)
+	assert.Equal(t, snap.State, restored.State())
+	assert.Equal(t, snap.CooldownUntilMillis, atomic.LoadInt64(&restored.cooldownUntilMillis))
+}
+
+func TestBreaker_Restore_RejectsUnknownVersion(t *testing.T) {
+	b := getSREBreaker()
+	err := b.Restore(Snapshot{Version: SnapshotVersion + 1})
+	assert.Error(t, err)
+}
+
+// TestBreaker_Restore_ReplacesRatherThanAdds guards against Restore accumulating onto
+// whatever the breaker already had, rather than replacing it: repeated syncer ticks in
+// the sre/sync package snapshot and restore the same breaker, so a Restore that merely
+// appends would make the window's counts grow without bound over time.
+func TestBreaker_Restore_ReplacesRatherThanAdds(t *testing.T) {
+	b := getSREBreaker()
+	markSuccess(b, 60)
+	markFailed(b, 40)
+	snap := b.Snapshot()
+
+	assert.NoError(t, b.Restore(snap))
+	a, tot := b.summary()
+	assert.Equal(t, int64(60), a)
+	assert.Equal(t, int64(100), tot)
+
+	assert.NoError(t, b.Restore(snap))
+	a, tot = b.summary()
+	assert.Equal(t, int64(60), a)
+	assert.Equal(t, int64(100), tot)
+}
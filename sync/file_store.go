@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	stdsync "sync"
+
+	sre "github.com/yimi-go/sre-circuit-breaker"
+)
+
+// FileStore is a Store backed by a single JSON file on disk, useful for sharing
+// snapshots between processes on the same host, e.g. over a shared volume, without a
+// network dependency. Save and Load each rewrite/reread the whole file under an
+// in-process mutex, so a FileStore is only safe for concurrent use from within one
+// process; coordinate separately if multiple processes write the same path.
+type FileStore struct {
+	path string
+	mu   stdsync.Mutex
+}
+
+// NewFileStore returns a FileStore backed by the file at path. The file is created on
+// the first Save if it doesn't already exist.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+type fileStoreDoc map[string]map[string]sre.Snapshot
+
+// Save implements Store.
+func (s *FileStore) Save(_ context.Context, key, instanceID string, snap sre.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, err := s.read()
+	if err != nil {
+		return err
+	}
+	if doc[key] == nil {
+		doc[key] = make(map[string]sre.Snapshot)
+	}
+	doc[key][instanceID] = snap
+	return s.write(doc)
+}
+
+// Load implements Store.
+func (s *FileStore) Load(_ context.Context, key string) (map[string]sre.Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return doc[key], nil
+}
+
+func (s *FileStore) read() (fileStoreDoc, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(fileStoreDoc), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return make(fileStoreDoc), nil
+	}
+	doc := make(fileStoreDoc)
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (s *FileStore) write(doc fileStoreDoc) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, b, 0o644)
+}
@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	sre "github.com/yimi-go/sre-circuit-breaker"
+)
+
+// ErrNotFound is returned by a RedisClient's Get when key doesn't exist, e.g. because
+// it expired. RedisStore treats it as "no peer published yet" rather than an error.
+var ErrNotFound = errors.New("sre/sync: key not found")
+
+// RedisClient is the subset of a Redis client's API RedisStore needs. It's declared
+// here rather than depending on a specific client library, so this package's
+// dependency footprint stays small and callers can bring whichever client version
+// their project already uses; wrap it in a small adapter, translating a missing key
+// into ErrNotFound (e.g. redis.Nil from github.com/redis/go-redis/v9).
+type RedisClient interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+}
+
+// RedisStore is a Store backed by a RedisClient, useful for sharing snapshots between
+// replicas that don't share a filesystem. Each published snapshot is set with ttl, so a
+// replica that stops publishing eventually drops out of its peers' merges instead of
+// being merged in forever.
+type RedisStore struct {
+	client RedisClient
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisStore returns a RedisStore that stores keys under prefix via client, expiring
+// each published snapshot after ttl.
+func NewRedisStore(client RedisClient, prefix string, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+// Save implements Store.
+func (s *RedisStore) Save(ctx context.Context, key, instanceID string, snap sre.Snapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Set(ctx, s.snapshotKey(key, instanceID), string(b), s.ttl); err != nil {
+		return err
+	}
+	ids, err := s.loadIndex(ctx, key)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, id := range ids {
+		if id == instanceID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		ids = append(ids, instanceID)
+	}
+	return s.saveIndex(ctx, key, ids)
+}
+
+// Load implements Store.
+func (s *RedisStore) Load(ctx context.Context, key string) (map[string]sre.Snapshot, error) {
+	ids, err := s.loadIndex(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]sre.Snapshot, len(ids))
+	live := make([]string, 0, len(ids))
+	pruned := false
+	for _, id := range ids {
+		v, err := s.client.Get(ctx, s.snapshotKey(key, id))
+		if errors.Is(err, ErrNotFound) {
+			pruned = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var snap sre.Snapshot
+		if err := json.Unmarshal([]byte(v), &snap); err != nil {
+			return nil, err
+		}
+		out[id] = snap
+		live = append(live, id)
+	}
+	// An instance whose snapshot key already expired is gone for good: its next Save
+	// would re-add it to the index anyway, so drop it now rather than letting every
+	// future Load keep paying for a Get that will just come back ErrNotFound again.
+	if pruned {
+		if err := s.saveIndex(ctx, key, live); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (s *RedisStore) loadIndex(ctx context.Context, key string) ([]string, error) {
+	v, err := s.client.Get(ctx, s.indexKey(key))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if err := json.Unmarshal([]byte(v), &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// saveIndex persists ids as key's instance index, refreshing its TTL unconditionally -
+// not just when the set of ids changes - so a long-running instance that keeps
+// publishing doesn't let the shared index expire out from under its still-live
+// snapshot key.
+func (s *RedisStore) saveIndex(ctx context.Context, key string, ids []string) error {
+	idx, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.indexKey(key), string(idx), s.ttl)
+}
+
+func (s *RedisStore) indexKey(key string) string {
+	return s.prefix + key + ":instances"
+}
+
+func (s *RedisStore) snapshotKey(key, instanceID string) string {
+	return s.prefix + key + ":" + instanceID
+}
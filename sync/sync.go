@@ -0,0 +1,225 @@
+// Package sync periodically publishes an sre circuit breaker's organic traffic to a
+// shared Store and merges every peer's published contribution back into it, so many
+// small clients that each individually see too few requests to trip ignoreRequests can
+// pool their view of backend health. Each round publishes and merges in only traffic
+// that's new since the last round, adding it on top of the breaker's existing pooled
+// total rather than reconstructing that total from scratch, so the pooled total grows
+// with real traffic only instead of compounding every tick.
+package sync
+
+import (
+	"context"
+	stdsync "sync"
+	"time"
+
+	sre "github.com/yimi-go/sre-circuit-breaker"
+)
+
+// Breaker is the subset of the sre breaker's API a Syncer needs.
+// github.com/yimi-go/sre-circuit-breaker's breaker type implements it.
+type Breaker interface {
+	Snapshot() sre.Snapshot
+	Restore(sre.Snapshot) error
+}
+
+// Store persists the snapshot most recently published by a given instance under a
+// shared key (e.g. the name of the backend being protected), and lists every
+// instance's latest snapshot for that key so a Syncer can merge its peers in.
+// Implementations: MemoryStore, FileStore, RedisStore.
+type Store interface {
+	// Save persists snap under key, as published by instanceID, replacing any
+	// previous value that instance published under key.
+	Save(ctx context.Context, key, instanceID string, snap sre.Snapshot) error
+	// Load returns the latest snapshot saved under key by every instance, keyed by
+	// instanceID. It returns an empty (possibly nil) map, not an error, if nothing has
+	// been saved yet.
+	Load(ctx context.Context, key string) (map[string]sre.Snapshot, error)
+}
+
+// Syncer publishes a Breaker's Snapshot to a Store under a shared key, and merges
+// every peer's published Snapshot back into the Breaker. The zero value is not usable;
+// construct one with NewSyncer.
+type Syncer struct {
+	breaker    Breaker
+	store      Store
+	key        string
+	instanceID string
+	interval   time.Duration
+
+	// baselineAccepts/baselineTotal is the aggregate accepts/total this Syncer last
+	// fed back into the breaker via Restore. SyncOnce subtracts it from the breaker's
+	// current aggregate to recover the traffic that's organically this instance's own
+	// since the last round, so it publishes only what's new rather than republishing
+	// (and so having peers re-sum) whatever was merged in last time.
+	baselineAccepts int64
+	baselineTotal   int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSyncer returns a Syncer that publishes breaker's snapshot to store under key, as
+// instanceID, every interval. instanceID must be unique among the processes sharing
+// key, so a Syncer doesn't merge its own previously-published snapshot back into itself
+// as though it were a peer.
+func NewSyncer(breaker Breaker, store Store, key, instanceID string, interval time.Duration) *Syncer {
+	return &Syncer{
+		breaker:    breaker,
+		store:      store,
+		key:        key,
+		instanceID: instanceID,
+		interval:   interval,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Run publishes and merges snapshots every interval, until ctx is done or Stop is
+// called. Run blocks; call it from its own goroutine.
+func (s *Syncer) Run(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			_ = s.SyncOnce(ctx)
+		}
+	}
+}
+
+// Stop ends a running Run loop and waits for it to return.
+func (s *Syncer) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// SyncOnce publishes this instance's organic traffic since the last round, then adds
+// every peer's equally fresh contribution on top of the breaker's existing pooled
+// total and restores that back into the breaker. Run calls SyncOnce on every tick;
+// call it directly to sync on demand or from a test.
+func (s *Syncer) SyncOnce(ctx context.Context) error {
+	full := s.breaker.Snapshot()
+	fullAccepts, fullTotal := aggregate(full)
+
+	if err := s.store.Save(ctx, s.key, s.instanceID, s.organicSnapshot(full, fullAccepts, fullTotal)); err != nil {
+		return err
+	}
+
+	peers, err := s.store.Load(ctx, s.key)
+	if err != nil {
+		return err
+	}
+	peerDelta := sre.Snapshot{Buckets: []sre.BucketSnapshot{{}}}
+	for id, peer := range peers {
+		if id == s.instanceID {
+			continue
+		}
+		peerDelta = MergeSnapshots(peerDelta, peer)
+	}
+
+	existing := full
+	existing.Buckets = []sre.BucketSnapshot{{Accepts: fullAccepts, Total: fullTotal}}
+	merged := MergeSnapshots(existing, peerDelta)
+
+	s.baselineAccepts, s.baselineTotal = aggregate(merged)
+	return s.breaker.Restore(merged)
+}
+
+// organicSnapshot derives this instance's own new traffic since the last round by
+// subtracting the aggregate this Syncer last restored (s.baselineAccepts/baselineTotal)
+// from full's current aggregate (fullAccepts/fullTotal). Nothing besides this
+// instance's own organic traffic and bucket expiry can change that aggregate between
+// two SyncOnce calls, so the difference is what's new less whatever expired out of the
+// window since then, clamped at zero; publishing only that,
+// rather than full's whole running total, keeps peers from re-summing what they (or
+// this instance) already merged in on a previous round. The result always carries
+// exactly one bucket, however small, so MergeSnapshots (which aligns peer buckets
+// against the callee's own) always has a slot to merge into.
+func (s *Syncer) organicSnapshot(full sre.Snapshot, fullAccepts, fullTotal int64) sre.Snapshot {
+	accepts := fullAccepts - s.baselineAccepts
+	total := fullTotal - s.baselineTotal
+	if accepts < 0 {
+		accepts = 0
+	}
+	if total < 0 {
+		total = 0
+	}
+	organic := full
+	organic.Buckets = []sre.BucketSnapshot{{Accepts: accepts, Total: total}}
+	return organic
+}
+
+// aggregate sums a Snapshot's bucketed accepts/total counts.
+func aggregate(snap sre.Snapshot) (accepts, total int64) {
+	for _, b := range snap.Buckets {
+		accepts += b.Accepts
+		total += b.Total
+	}
+	return
+}
+
+// MergeSnapshots combines a and b's bucketed accepts/total counts by summing
+// corresponding buckets, aligned from the newest bucket (the end of each Buckets
+// slice) backward, so windows of different lengths still line up sensibly. The
+// returned Snapshot otherwise keeps a's fields: merging pools request volume across
+// instances, it does not share one instance's circuit-breaker state with another.
+func MergeSnapshots(a, b sre.Snapshot) sre.Snapshot {
+	merged := a
+	merged.Buckets = make([]sre.BucketSnapshot, len(a.Buckets))
+	copy(merged.Buckets, a.Buckets)
+	for i := 0; i < len(b.Buckets); i++ {
+		ai := len(merged.Buckets) - 1 - i
+		bi := len(b.Buckets) - 1 - i
+		if ai < 0 {
+			break
+		}
+		merged.Buckets[ai].Accepts += b.Buckets[bi].Accepts
+		merged.Buckets[ai].Total += b.Buckets[bi].Total
+	}
+	return merged
+}
+
+// MemoryStore is an in-process Store backed by a map, useful for tests and for
+// sharing snapshots between breakers in the same process. The zero value is ready to
+// use.
+type MemoryStore struct {
+	mu   stdsync.Mutex
+	data map[string]map[string]sre.Snapshot
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(_ context.Context, key, instanceID string, snap sre.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make(map[string]map[string]sre.Snapshot)
+	}
+	if s.data[key] == nil {
+		s.data[key] = make(map[string]sre.Snapshot)
+	}
+	s.data[key][instanceID] = snap
+	return nil
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load(_ context.Context, key string) (map[string]sre.Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	peers := s.data[key]
+	out := make(map[string]sre.Snapshot, len(peers))
+	for id, snap := range peers {
+		out[id] = snap
+	}
+	return out, nil
+}
+
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*FileStore)(nil)
+	_ Store = (*RedisStore)(nil)
+)
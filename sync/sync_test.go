@@ -0,0 +1,219 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	sre "github.com/yimi-go/sre-circuit-breaker"
+)
+
+type fakeBreaker struct {
+	snap    sre.Snapshot
+	restore sre.Snapshot
+}
+
+func (b *fakeBreaker) Snapshot() sre.Snapshot       { return b.snap }
+func (b *fakeBreaker) Restore(s sre.Snapshot) error { b.restore = s; return nil }
+
+func bucketSnapshot(accepts, total int64) sre.Snapshot {
+	return sre.Snapshot{
+		Version: sre.SnapshotVersion,
+		Buckets: []sre.BucketSnapshot{{Accepts: accepts, Total: total}},
+	}
+}
+
+func TestMergeSnapshots_SumsAlignedBuckets(t *testing.T) {
+	a := sre.Snapshot{Buckets: []sre.BucketSnapshot{{Accepts: 1, Total: 2}, {Accepts: 3, Total: 4}}}
+	b := sre.Snapshot{Buckets: []sre.BucketSnapshot{{Accepts: 10, Total: 20}}}
+	merged := MergeSnapshots(a, b)
+	assert.Equal(t, []sre.BucketSnapshot{{Accepts: 1, Total: 2}, {Accepts: 13, Total: 24}}, merged.Buckets)
+}
+
+func TestMemoryStore_SaveLoad(t *testing.T) {
+	store := &MemoryStore{}
+	ctx := context.Background()
+	assert.NoError(t, store.Save(ctx, "backend", "a", bucketSnapshot(1, 2)))
+	assert.NoError(t, store.Save(ctx, "backend", "b", bucketSnapshot(3, 4)))
+
+	peers, err := store.Load(ctx, "backend")
+	assert.NoError(t, err)
+	assert.Len(t, peers, 2)
+	assert.Equal(t, int64(1), peers["a"].Buckets[0].Accepts)
+	assert.Equal(t, int64(3), peers["b"].Buckets[0].Accepts)
+}
+
+func TestFileStore_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshots.json")
+	store := NewFileStore(path)
+	ctx := context.Background()
+
+	peers, err := store.Load(ctx, "backend")
+	assert.NoError(t, err)
+	assert.Empty(t, peers)
+
+	assert.NoError(t, store.Save(ctx, "backend", "a", bucketSnapshot(5, 10)))
+	peers, err = store.Load(ctx, "backend")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), peers["a"].Buckets[0].Accepts)
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+type memoryRedisClient struct {
+	data map[string]string
+	ttls map[string]time.Duration
+}
+
+func (c *memoryRedisClient) Get(_ context.Context, key string) (string, error) {
+	v, ok := c.data[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+func (c *memoryRedisClient) Set(_ context.Context, key, value string, ttl time.Duration) error {
+	if c.data == nil {
+		c.data = make(map[string]string)
+		c.ttls = make(map[string]time.Duration)
+	}
+	c.data[key] = value
+	c.ttls[key] = ttl
+	return nil
+}
+
+func TestRedisStore_SaveLoad(t *testing.T) {
+	client := &memoryRedisClient{}
+	store := NewRedisStore(client, "sre:", time.Minute)
+	ctx := context.Background()
+
+	peers, err := store.Load(ctx, "backend")
+	assert.NoError(t, err)
+	assert.Empty(t, peers)
+
+	assert.NoError(t, store.Save(ctx, "backend", "a", bucketSnapshot(7, 9)))
+	assert.NoError(t, store.Save(ctx, "backend", "b", bucketSnapshot(1, 1)))
+
+	peers, err = store.Load(ctx, "backend")
+	assert.NoError(t, err)
+	assert.Len(t, peers, 2)
+	assert.Equal(t, int64(7), peers["a"].Buckets[0].Accepts)
+}
+
+// TestRedisStore_Save_RefreshesIndexTTLOnEveryCall guards against the index key's TTL
+// only being renewed when a new instance ID is appended: a long-running instance that
+// keeps calling Save every tick must keep the shared index alive too, or Load eventually
+// treats live peers as if they'd never published.
+func TestRedisStore_Save_RefreshesIndexTTLOnEveryCall(t *testing.T) {
+	client := &memoryRedisClient{}
+	store := NewRedisStore(client, "sre:", time.Minute)
+	ctx := context.Background()
+
+	assert.NoError(t, store.Save(ctx, "backend", "a", bucketSnapshot(1, 1)))
+	client.ttls[store.indexKey("backend")] = 0
+
+	assert.NoError(t, store.Save(ctx, "backend", "a", bucketSnapshot(2, 2)))
+	assert.Equal(t, time.Minute, client.ttls[store.indexKey("backend")])
+}
+
+// TestRedisStore_Load_PrunesExpiredInstancesFromIndex guards against the index
+// accumulating dead instance IDs forever: once an instance's snapshot key has expired,
+// Load must drop it from the index instead of paying for an ErrNotFound Get on it
+// forever.
+func TestRedisStore_Load_PrunesExpiredInstancesFromIndex(t *testing.T) {
+	client := &memoryRedisClient{}
+	store := NewRedisStore(client, "sre:", time.Minute)
+	ctx := context.Background()
+
+	assert.NoError(t, store.Save(ctx, "backend", "a", bucketSnapshot(1, 1)))
+	assert.NoError(t, store.Save(ctx, "backend", "b", bucketSnapshot(2, 2)))
+	delete(client.data, store.snapshotKey("backend", "a"))
+
+	peers, err := store.Load(ctx, "backend")
+	assert.NoError(t, err)
+	assert.Len(t, peers, 1)
+	assert.Equal(t, int64(2), peers["b"].Buckets[0].Accepts)
+
+	ids, err := store.loadIndex(ctx, "backend")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, ids)
+}
+
+func TestSyncer_SyncOnce_MergesPeersExcludingSelf(t *testing.T) {
+	store := &MemoryStore{}
+	ctx := context.Background()
+	assert.NoError(t, store.Save(ctx, "backend", "peer", bucketSnapshot(100, 200)))
+
+	b := &fakeBreaker{snap: bucketSnapshot(1, 2)}
+	syncer := NewSyncer(b, store, "backend", "self", time.Millisecond)
+
+	assert.NoError(t, syncer.SyncOnce(ctx))
+	assert.Equal(t, int64(101), b.restore.Buckets[0].Accepts)
+	assert.Equal(t, int64(202), b.restore.Buckets[0].Total)
+
+	peers, err := store.Load(ctx, "backend")
+	assert.NoError(t, err)
+	assert.Equal(t, b.snap, peers["self"])
+}
+
+// statefulFakeBreaker is a fakeBreaker that actually keeps whatever Restore gave it, the
+// way the real breaker does, so repeated SyncOnce rounds can be driven against it.
+type statefulFakeBreaker struct {
+	snap sre.Snapshot
+}
+
+func (b *statefulFakeBreaker) Snapshot() sre.Snapshot       { return b.snap }
+func (b *statefulFakeBreaker) Restore(s sre.Snapshot) error { b.snap = s; return nil }
+
+// TestSyncer_SyncOnce_BoundedOverManyRounds guards against the pooled total compounding
+// round over round: two instances each starting with 100 organic requests should settle
+// at a pooled 200, not double every round (100 -> 200 -> 400 -> 800 -> ...).
+func TestSyncer_SyncOnce_BoundedOverManyRounds(t *testing.T) {
+	store := &MemoryStore{}
+	ctx := context.Background()
+
+	a := &statefulFakeBreaker{snap: bucketSnapshot(100, 100)}
+	b := &statefulFakeBreaker{snap: bucketSnapshot(100, 100)}
+	syncerA := NewSyncer(a, store, "backend", "a", time.Millisecond)
+	syncerB := NewSyncer(b, store, "backend", "b", time.Millisecond)
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, syncerA.SyncOnce(ctx))
+		assert.NoError(t, syncerB.SyncOnce(ctx))
+	}
+
+	_, totalA := aggregate(a.snap)
+	_, totalB := aggregate(b.snap)
+	assert.Equal(t, int64(200), totalA)
+	assert.Equal(t, int64(200), totalB)
+}
+
+// TestNewSyncer_WithRealBreaker wires sre.New's result straight into NewSyncer, the way
+// a real caller would, rather than through fakeBreaker: it catches Breaker interface
+// drift in the sre package that a hand-rolled stand-in can't.
+func TestNewSyncer_WithRealBreaker(t *testing.T) {
+	store := &MemoryStore{}
+	syncer := NewSyncer(sre.New(), store, "backend", "self", time.Millisecond)
+	assert.NoError(t, syncer.SyncOnce(context.Background()))
+}
+
+func TestSyncer_RunStop(t *testing.T) {
+	store := &MemoryStore{}
+	b := &fakeBreaker{snap: bucketSnapshot(1, 1)}
+	syncer := NewSyncer(b, store, "backend", "self", time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		syncer.Run(context.Background())
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	syncer.Stop()
+	<-done
+}